@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/user"
+	"github.com/grafana/tempo/modules/generator/processor/localblocks"
+	"github.com/grafana/tempo/pkg/tempopb"
+	"github.com/grafana/tempo/pkg/util"
+	"github.com/grafana/tempo/pkg/util/log"
+	"github.com/grafana/tempo/tempodb/encoding/common"
+)
+
+// localBlocksFinder looks up the LocalBlocks processor instance serving a
+// tenant, if any. The generator's instance manager implements this.
+type localBlocksFinder interface {
+	GetLocalBlocksProcessor(tenant string) *localblocks.Processor
+}
+
+// RegisterLocalBlocksAPI registers the generator's local-data query
+// endpoints, which let callers search the freshest traces (live, WAL, and
+// complete blocks) this generator instance is holding without waiting for
+// ingester flush.
+//
+// This is a partial, draft-status piece of "local TraceQL search": it is not
+// reachable by any caller in this checkout, and landing the rest is out of
+// scope here rather than silently assumed. Specifically, nothing calls
+// RegisterLocalBlocksAPI and no type implements localBlocksFinder -- the
+// Generator service/instance manager that would own the module's HTTP
+// router and per-tenant processor map isn't present (modules/generator
+// holds only config.go, this file and the processor/localblocks package).
+// Separately, and more
+// fundamentally, the querier-side ring fan-out that was meant to query
+// generator replicas via RingKey and merge their results with the backend
+// doesn't exist either, since modules/querier isn't present in this
+// checkout at all. Both need to land as their own follow-up work, with
+// their own review, before this endpoint does anything a client can
+// observe.
+func RegisterLocalBlocksAPI(router *mux.Router, finder localBlocksFinder) {
+	router.HandleFunc("/api/generator/search", newSearchHandler(finder))
+	router.HandleFunc("/api/generator/search/tags", newSearchTagsHandler(finder))
+	router.HandleFunc("/api/generator/trace/{traceID}", newTraceByIDHandler(finder))
+}
+
+func newSearchHandler(finder localBlocksFinder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := processorForRequest(w, r, finder)
+		if p == nil {
+			return
+		}
+
+		req := &tempopb.SearchRequest{
+			Tags:  parseTagsParam(r.URL.Query()["tags"]),
+			Limit: uint32(parseUintParam(r.URL.Query().Get("limit"))),
+			Start: uint32(parseUintParam(r.URL.Query().Get("start"))),
+			End:   uint32(parseUintParam(r.URL.Query().Get("end"))),
+		}
+
+		resp, err := p.Search(r.Context(), req, localblocks.DefaultQueryBudget)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSONPB(w, resp)
+	}
+}
+
+func newSearchTagsHandler(finder localBlocksFinder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := processorForRequest(w, r, finder)
+		if p == nil {
+			return
+		}
+
+		resp, err := p.SearchTags(r.Context(), r.URL.Query().Get("scope"), localblocks.DefaultQueryBudget)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSONPB(w, resp)
+	}
+}
+
+func newTraceByIDHandler(finder localBlocksFinder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := processorForRequest(w, r, finder)
+		if p == nil {
+			return
+		}
+
+		id, err := util.HexStringToTraceID(mux.Vars(r)["traceID"])
+		if err != nil {
+			http.Error(w, "invalid trace id: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		trace, err := p.FindTraceByID(r.Context(), common.ID(id), localblocks.DefaultQueryBudget)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if trace == nil {
+			http.Error(w, "trace not found", http.StatusNotFound)
+			return
+		}
+
+		writeJSONPB(w, trace)
+	}
+}
+
+func processorForRequest(w http.ResponseWriter, r *http.Request, finder localBlocksFinder) *localblocks.Processor {
+	tenant, err := user.ExtractOrgID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	p := finder.GetLocalBlocksProcessor(tenant)
+	if p == nil {
+		http.Error(w, "local blocks processor not running for tenant", http.StatusNotFound)
+		return nil
+	}
+
+	return p
+}
+
+// parseTagsParam combines repeated "tags=key=value" query parameters into a
+// single filter set, e.g. ?tags=k=v&tags=k2=v2.
+func parseTagsParam(values []string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	tags := make(map[string]string, len(values))
+	for _, v := range values {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok {
+			continue
+		}
+		tags[k] = val
+	}
+
+	return tags
+}
+
+func parseUintParam(s string) uint64 {
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func writeJSONPB(w http.ResponseWriter, msg proto.Message) {
+	w.Header().Set("Content-Type", "application/json")
+
+	marshaler := &jsonpb.Marshaler{}
+	if err := marshaler.Marshal(w, msg); err != nil {
+		level.Error(log.Logger).Log("msg", "failed to marshal generator query response", "err", err)
+	}
+}
@@ -109,5 +109,14 @@ func (cfg *ProcessorConfig) copyWithOverrides(o metricsGeneratorOverrides, userI
 		copyCfg.LocalBlocks.CompleteBlockTimeout = timeout
 	}
 
+	copyCfg.LocalBlocks.RemoteWrite.Enabled = o.MetricsGeneratorProcessorLocalBlocksRemoteWriteEnabled(userID)
+
+	if kinds := o.MetricsGeneratorProcessorLocalBlocksFilterSpanKinds(userID); kinds != nil {
+		copyCfg.LocalBlocks.Filter.SpanKinds = kinds
+	}
+	if policies := o.MetricsGeneratorProcessorLocalBlocksFilterPolicies(userID); policies != nil {
+		copyCfg.LocalBlocks.Filter.FilterPolicies = policies
+	}
+
 	return copyCfg, nil
 }
@@ -0,0 +1,321 @@
+package localblocks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/google/uuid"
+	v1 "github.com/grafana/tempo/pkg/tempopb/trace/v1"
+	"github.com/grafana/tempo/pkg/util/log"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding/common"
+)
+
+const (
+	checkpointFilePrefix = "checkpoint."
+	checkpointVersion    = 1
+)
+
+// checkpoint is the durable, point-in-time snapshot of the processor's
+// in-memory and on-disk state. It lets reloadBlocks skip re-deriving
+// everything it already knew about at the time the checkpoint was taken.
+type checkpoint struct {
+	LiveTraces     []checkpointTrace
+	HeadBlockID    uuid.UUID
+	HeadBlockLen   uint64
+	WALBlocks      []*backend.BlockMeta
+	CompleteBlocks []*backend.BlockMeta
+}
+
+type checkpointTrace struct {
+	ID        []byte
+	Batches   [][]byte
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+func (p *Processor) checkpointLoop() {
+	defer p.wg.Done()
+
+	if p.Cfg.CheckpointInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.Cfg.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.writeCheckpoint(); err != nil {
+				level.Error(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to write checkpoint", "err", err)
+				continue
+			}
+			if err := p.pruneCheckpoints(); err != nil {
+				level.Error(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to prune checkpoints", "err", err)
+			}
+
+		case <-p.closeCh:
+			return
+		}
+	}
+}
+
+// writeCheckpoint snapshots liveTraces and the current block state and
+// serializes it to a new checkpoint file. It does not truncate or delete any
+// WAL segments itself -- wal.WAL doesn't expose a way to drop part of a
+// segment, and whole segments are already removed by the normal
+// cut/complete/delete loops once their data lands in a complete block. The
+// checkpoint only needs to record enough for reloadBlocks to skip
+// re-deriving state that's still valid.
+func (p *Processor) writeCheckpoint() error {
+	dir := p.checkpointDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create checkpoint dir: %w", err)
+	}
+
+	ck := checkpoint{}
+
+	p.liveTracesMtx.Lock()
+	for _, t := range p.liveTraces.traces {
+		ct := checkpointTrace{
+			ID:        t.id,
+			CreatedAt: t.createdAt.UnixNano(),
+			UpdatedAt: t.updatedAt.UnixNano(),
+		}
+		for _, b := range t.Batches {
+			buf, err := proto.Marshal(b)
+			if err != nil {
+				p.liveTracesMtx.Unlock()
+				return fmt.Errorf("failed to marshal live trace batch: %w", err)
+			}
+			ct.Batches = append(ct.Batches, buf)
+		}
+		ck.LiveTraces = append(ck.LiveTraces, ct)
+	}
+	p.liveTracesMtx.Unlock()
+
+	p.blocksMtx.Lock()
+	if p.headBlock != nil {
+		ck.HeadBlockID = p.headBlock.BlockMeta().BlockID
+		ck.HeadBlockLen = p.headBlock.DataLength()
+	}
+	for _, b := range p.walBlocks {
+		ck.WALBlocks = append(ck.WALBlocks, b.BlockMeta())
+	}
+	for _, b := range p.completeBlocks {
+		ck.CompleteBlocks = append(ck.CompleteBlocks, b.BlockMeta())
+	}
+	p.blocksMtx.Unlock()
+
+	p.checkpointSeqMtx.Lock()
+	seq := p.checkpointSeq
+	p.checkpointSeq++
+	p.checkpointSeqMtx.Unlock()
+
+	path := filepath.Join(dir, checkpointFileName(seq))
+	tmp := path + ".tmp"
+
+	if err := writeCheckpointFile(tmp, &ck); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func writeCheckpointFile(path string, ck *checkpoint) error {
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(ck); err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	crc := crc32.ChecksumIEEE(body.Bytes())
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+	defer f.Close()
+
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[0:4], checkpointVersion)
+	binary.LittleEndian.PutUint32(header[4:8], crc)
+
+	if _, err := f.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := f.Write(body.Bytes()); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func readCheckpointFile(path string) (*checkpoint, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 8 {
+		return nil, fmt.Errorf("checkpoint %s is truncated", path)
+	}
+
+	version := binary.LittleEndian.Uint32(buf[0:4])
+	if version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint %s has unsupported version %d", path, version)
+	}
+
+	wantCRC := binary.LittleEndian.Uint32(buf[4:8])
+	body := buf[8:]
+	if gotCRC := crc32.ChecksumIEEE(body); gotCRC != wantCRC {
+		return nil, fmt.Errorf("checkpoint %s failed crc check", path)
+	}
+
+	var ck checkpoint
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&ck); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %s: %w", path, err)
+	}
+
+	return &ck, nil
+}
+
+// loadLatestCheckpoint returns the newest valid checkpoint in dir, trying
+// progressively older ones if the newest is missing or corrupt. It also
+// returns the sequence number to resume allocating from.
+func loadLatestCheckpoint(dir string) (*checkpoint, int, error) {
+	seqs, err := checkpointSeqs(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(seqs) == 0 {
+		return nil, 0, nil
+	}
+
+	nextSeq := seqs[len(seqs)-1] + 1
+
+	for i := len(seqs) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, checkpointFileName(seqs[i]))
+		ck, err := readCheckpointFile(path)
+		if err != nil {
+			level.Warn(log.Logger).Log("msg", "local blocks processor discarding corrupt checkpoint", "file", path, "err", err)
+			continue
+		}
+		return ck, nextSeq, nil
+	}
+
+	return nil, nextSeq, nil
+}
+
+// pruneCheckpoints deletes all but the most recent CheckpointRetention
+// checkpoint files.
+func (p *Processor) pruneCheckpoints() error {
+	if p.Cfg.CheckpointRetention <= 0 {
+		return nil
+	}
+
+	dir := p.checkpointDir()
+	seqs, err := checkpointSeqs(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(seqs) <= p.Cfg.CheckpointRetention {
+		return nil
+	}
+
+	for _, seq := range seqs[:len(seqs)-p.Cfg.CheckpointRetention] {
+		path := filepath.Join(dir, checkpointFileName(seq))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkpointSeqs returns the sequence numbers of all checkpoint files in dir,
+// sorted ascending.
+func checkpointSeqs(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []int
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), checkpointFilePrefix) {
+			continue
+		}
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimPrefix(e.Name(), checkpointFilePrefix))
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+func checkpointFileName(seq int) string {
+	return fmt.Sprintf("%s%010d", checkpointFilePrefix, seq)
+}
+
+func (p *Processor) checkpointDir() string {
+	return filepath.Join(p.wal.Dir(), p.tenant, "checkpoints")
+}
+
+// restoreFromCheckpoint rehydrates liveTraces and adopts ck's head block if
+// it is still present in walBlocks (removing it from walBlocks), returning
+// the IDs of the complete blocks recorded in ck, whose meta reloadBlocks can
+// take from the checkpoint instead of re-reading it from the backend.
+func (p *Processor) restoreFromCheckpoint(ck *checkpoint, walBlocks map[uuid.UUID]common.WALBlock) (map[uuid.UUID]struct{}, error) {
+	known := map[uuid.UUID]struct{}{}
+
+	for _, ct := range ck.LiveTraces {
+		t := &liveTrace{
+			id:        ct.ID,
+			createdAt: time.Unix(0, ct.CreatedAt),
+			updatedAt: time.Unix(0, ct.UpdatedAt),
+		}
+		for _, buf := range ct.Batches {
+			var b v1.ResourceSpans
+			if err := proto.Unmarshal(buf, &b); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal checkpointed trace: %w", err)
+			}
+			t.Batches = append(t.Batches, &b)
+		}
+		p.liveTraces.traces[fingerprint(t.id)] = t
+	}
+
+	if ck.HeadBlockID != uuid.Nil {
+		if blk, ok := walBlocks[ck.HeadBlockID]; ok {
+			p.headBlock = blk
+			p.lastCutTime = time.Now()
+			delete(walBlocks, ck.HeadBlockID)
+		}
+	}
+
+	for _, meta := range ck.CompleteBlocks {
+		known[meta.BlockID] = struct{}{}
+	}
+
+	return known, nil
+}
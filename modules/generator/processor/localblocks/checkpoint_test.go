@@ -0,0 +1,90 @@
+package localblocks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tempo/tempodb/backend"
+)
+
+func TestCheckpointWriteReadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, checkpointFileName(0))
+
+	want := &checkpoint{
+		HeadBlockID:  uuid.New(),
+		HeadBlockLen: 1234,
+		LiveTraces: []checkpointTrace{
+			{ID: []byte{1, 2, 3}, CreatedAt: 1, UpdatedAt: 2},
+		},
+		WALBlocks:      []*backend.BlockMeta{{BlockID: uuid.New(), TenantID: "t"}},
+		CompleteBlocks: []*backend.BlockMeta{{BlockID: uuid.New(), TenantID: "t"}},
+	}
+
+	require.NoError(t, writeCheckpointFile(path, want))
+
+	got, err := readCheckpointFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, want.HeadBlockID, got.HeadBlockID)
+	assert.Equal(t, want.HeadBlockLen, got.HeadBlockLen)
+	assert.Equal(t, want.LiveTraces, got.LiveTraces)
+	assert.Equal(t, want.WALBlocks[0].BlockID, got.WALBlocks[0].BlockID)
+	assert.Equal(t, want.CompleteBlocks[0].BlockID, got.CompleteBlocks[0].BlockID)
+}
+
+func TestReadCheckpointFileRejectsTruncatedAndCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, checkpointFileName(0))
+	require.NoError(t, writeCheckpointFile(path, &checkpoint{HeadBlockLen: 1}))
+
+	truncated := filepath.Join(dir, "truncated")
+	require.NoError(t, os.WriteFile(truncated, []byte{1, 2, 3}, 0o644))
+	_, err := readCheckpointFile(truncated)
+	assert.Error(t, err)
+
+	buf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	buf[len(buf)-1] ^= 0xFF // flip a byte in the body so the CRC no longer matches
+	corrupt := filepath.Join(dir, "corrupt")
+	require.NoError(t, os.WriteFile(corrupt, buf, 0o644))
+	_, err = readCheckpointFile(corrupt)
+	assert.Error(t, err)
+}
+
+func TestLoadLatestCheckpointFallsBackOnCorruption(t *testing.T) {
+	dir := t.TempDir()
+
+	good := &checkpoint{HeadBlockID: uuid.New(), HeadBlockLen: 42}
+	require.NoError(t, writeCheckpointFile(filepath.Join(dir, checkpointFileName(0)), good))
+
+	bad := &checkpoint{HeadBlockID: uuid.New(), HeadBlockLen: 99}
+	badPath := filepath.Join(dir, checkpointFileName(1))
+	require.NoError(t, writeCheckpointFile(badPath, bad))
+
+	buf, err := os.ReadFile(badPath)
+	require.NoError(t, err)
+	buf[len(buf)-1] ^= 0xFF
+	require.NoError(t, os.WriteFile(badPath, buf, 0o644))
+
+	ck, nextSeq, err := loadLatestCheckpoint(dir)
+	require.NoError(t, err)
+	require.NotNil(t, ck)
+
+	assert.Equal(t, good.HeadBlockID, ck.HeadBlockID)
+	assert.Equal(t, good.HeadBlockLen, ck.HeadBlockLen)
+	assert.Equal(t, 2, nextSeq) // still allocates past the corrupt file's sequence number
+}
+
+func TestLoadLatestCheckpointEmptyDir(t *testing.T) {
+	ck, nextSeq, err := loadLatestCheckpoint(t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, ck)
+	assert.Equal(t, 0, nextSeq)
+}
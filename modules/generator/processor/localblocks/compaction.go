@@ -0,0 +1,304 @@
+package localblocks
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/tempo/pkg/util/log"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/encoding/common"
+)
+
+func (p *Processor) compactionLoop() {
+	defer p.wg.Done()
+
+	if len(p.Cfg.CompactionRanges) == 0 || p.Cfg.CompactionMinBlocks <= 1 {
+		return
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			var wg sync.WaitGroup
+			for i := 0; i < p.Cfg.CompactionConcurrency; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := p.compact(); err != nil {
+						metricCompactionsFailed.WithLabelValues(p.tenant).Inc()
+						level.Error(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to compact blocks", "err", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+		case <-p.closeCh:
+			return
+		}
+	}
+}
+
+// compact finds one group of adjacent, same-tier complete blocks and
+// rewrites them into a single larger block. It builds the merged block
+// outside blocksMtx and only takes the lock again to swap the result in.
+func (p *Processor) compact() error {
+	group, srcLevel := p.planCompaction()
+	if len(group) < p.Cfg.CompactionMinBlocks {
+		return nil
+	}
+	defer p.unclaimBlocks(group)
+
+	metricCompactionsAttempted.WithLabelValues(p.tenant).Inc()
+
+	ctx := context.Background()
+	var (
+		enc    = encoding.DefaultEncoding()
+		reader = backend.NewReader(p.wal.LocalBackend())
+		writer = backend.NewWriter(p.wal.LocalBackend())
+	)
+
+	iters := make([]common.Iterator, 0, len(group))
+	var reclaimed uint64
+	for _, b := range group {
+		iter, err := b.Iterator()
+		if err != nil {
+			return err
+		}
+		defer iter.Close()
+		iters = append(iters, iter)
+		reclaimed += b.BlockMeta().Size
+	}
+
+	template := &backend.BlockMeta{
+		TenantID:        p.tenant,
+		CompactionLevel: srcLevel + 1,
+	}
+
+	newMeta, err := enc.CreateBlock(ctx, p.Cfg.Block, template, newMergeIterator(iters), reader, writer)
+	if err != nil {
+		return err
+	}
+
+	newBlock, err := enc.OpenBlock(newMeta, reader)
+	if err != nil {
+		return err
+	}
+
+	// Swap the merged block in for the group it replaces. Re-check that
+	// every source block is still present in case deleteOldBlocks (or
+	// another compaction) raced us and already removed one.
+	p.blocksMtx.Lock()
+	for _, b := range group {
+		if _, ok := p.completeBlocks[b.BlockMeta().BlockID]; !ok {
+			p.blocksMtx.Unlock()
+			metricCompactionsFailed.WithLabelValues(p.tenant).Inc()
+			return p.wal.LocalBackend().ClearBlock(newMeta.BlockID, p.tenant)
+		}
+	}
+	for _, b := range group {
+		delete(p.completeBlocks, b.BlockMeta().BlockID)
+	}
+	p.completeBlocks[newMeta.BlockID] = newBlock
+	p.blocksMtx.Unlock()
+
+	for _, b := range group {
+		if err := p.wal.LocalBackend().ClearBlock(b.BlockMeta().BlockID, p.tenant); err != nil {
+			level.Error(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to clear compacted block", "block", b.BlockMeta().BlockID, "err", err)
+		}
+	}
+
+	metricCompactionsSucceeded.WithLabelValues(p.tenant).Inc()
+	metricCompactionBytesReclaimed.WithLabelValues(p.tenant).Add(float64(reclaimed))
+
+	return nil
+}
+
+// planCompaction selects a candidate group of adjacent complete blocks at
+// the same compaction level that all fit within a single tier range, and
+// returns the level they were compacted from. Blocks already claimed by
+// another in-flight compact() are skipped, and the returned group is
+// claimed before the lock is released, so concurrent callers from the same
+// compactionLoop tick pick disjoint groups instead of redundantly merging
+// the same one.
+func (p *Processor) planCompaction() ([]common.BackendBlock, uint8) {
+	p.blocksMtx.Lock()
+	defer p.blocksMtx.Unlock()
+
+	blocks := make([]common.BackendBlock, 0, len(p.completeBlocks))
+	for id, b := range p.completeBlocks {
+		if _, claimed := p.compactingBlocks[id]; claimed {
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+
+	// Blocks nearing expiry are left alone so we don't race deleteOldBlocks.
+	// A block is only eligible while its EndTime is less than half of
+	// CompleteBlockTimeout in the past, i.e. it still has plenty of time
+	// left before deleteOldBlocks would remove it.
+	cutoff := time.Now().Add(-p.Cfg.CompleteBlockTimeout / 2)
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].BlockMeta().StartTime.Before(blocks[j].BlockMeta().StartTime)
+	})
+
+	byLevel := map[uint8][]common.BackendBlock{}
+	for _, b := range blocks {
+		meta := b.BlockMeta()
+		if meta.EndTime.Before(cutoff) {
+			continue
+		}
+		byLevel[meta.CompactionLevel] = append(byLevel[meta.CompactionLevel], b)
+	}
+
+	for _, blocksAtLevel := range byLevel {
+		for _, r := range p.Cfg.CompactionRanges {
+			group := groupWithinRange(blocksAtLevel, r, p.Cfg.CompactionMinBlocks)
+			if len(group) >= p.Cfg.CompactionMinBlocks {
+				for _, b := range group {
+					p.compactingBlocks[b.BlockMeta().BlockID] = struct{}{}
+				}
+				return group, group[0].BlockMeta().CompactionLevel
+			}
+		}
+	}
+
+	return nil, 0
+}
+
+// unclaimBlocks releases a group claimed by planCompaction once compact()
+// is done with it, whether or not it succeeded.
+func (p *Processor) unclaimBlocks(group []common.BackendBlock) {
+	p.blocksMtx.Lock()
+	defer p.blocksMtx.Unlock()
+
+	for _, b := range group {
+		delete(p.compactingBlocks, b.BlockMeta().BlockID)
+	}
+}
+
+// groupWithinRange returns the first run of at least minBlocks adjacent
+// blocks (sorted by StartTime) whose combined span fits inside r, or nil if
+// there is none.
+func groupWithinRange(blocks []common.BackendBlock, r time.Duration, minBlocks int) []common.BackendBlock {
+	for i := range blocks {
+		start := blocks[i].BlockMeta().StartTime
+		var group []common.BackendBlock
+
+		for j := i; j < len(blocks); j++ {
+			end := blocks[j].BlockMeta().EndTime
+			if end.Sub(start) > r {
+				break
+			}
+			group = append(group, blocks[j])
+		}
+
+		if len(group) >= minBlocks {
+			return group
+		}
+	}
+
+	return nil
+}
+
+// mergeIterator k-way merges a set of source block iterators into a single
+// stream sorted by trace ID. enc.CreateBlock relies on its input being
+// sorted to build a usable index, and trace IDs are effectively random
+// across blocks, so a plain concatenation of the (individually sorted)
+// source iterators is not enough.
+type mergeIterator struct {
+	pending []common.Iterator
+	h       mergeHeap
+}
+
+type mergeHeapEntry struct {
+	iter common.Iterator
+	id   common.ID
+	obj  []byte
+}
+
+type mergeHeap []*mergeHeapEntry
+
+func (h mergeHeap) Len() int            { return len(h) }
+func (h mergeHeap) Less(i, j int) bool  { return bytes.Compare(h[i].id, h[j].id) < 0 }
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeHeapEntry)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
+
+func newMergeIterator(iters []common.Iterator) *mergeIterator {
+	return &mergeIterator{pending: iters, h: make(mergeHeap, 0, len(iters))}
+}
+
+// init seeds the heap with the first entry from every source iterator. It's
+// deferred to the first Next call so construction can't fail.
+func (m *mergeIterator) init(ctx context.Context) error {
+	for _, iter := range m.pending {
+		id, obj, err := iter.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			iter.Close()
+			continue
+		}
+		m.h = append(m.h, &mergeHeapEntry{iter: iter, id: id, obj: obj})
+	}
+	m.pending = nil
+	heap.Init(&m.h)
+	return nil
+}
+
+func (m *mergeIterator) Next(ctx context.Context) (common.ID, []byte, error) {
+	if m.pending != nil {
+		if err := m.init(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if m.h.Len() == 0 {
+		return nil, nil, nil
+	}
+
+	entry := m.h[0]
+	id, obj := entry.id, entry.obj
+
+	next, nextObj, err := entry.iter.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if next == nil {
+		entry.iter.Close()
+		heap.Pop(&m.h)
+	} else {
+		entry.id, entry.obj = next, nextObj
+		heap.Fix(&m.h, 0)
+	}
+
+	return id, obj, nil
+}
+
+func (m *mergeIterator) Close() {
+	for _, iter := range m.pending {
+		iter.Close()
+	}
+	for _, entry := range m.h {
+		entry.iter.Close()
+	}
+}
+
+var _ common.Iterator = (*mergeIterator)(nil)
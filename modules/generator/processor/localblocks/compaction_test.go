@@ -0,0 +1,114 @@
+package localblocks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding/common"
+)
+
+type fakeBackendBlock struct {
+	meta *backend.BlockMeta
+}
+
+func (f *fakeBackendBlock) BlockMeta() *backend.BlockMeta { return f.meta }
+
+func newFakeBlock(start, end time.Time, level uint8) common.BackendBlock {
+	return &fakeBackendBlock{meta: &backend.BlockMeta{
+		BlockID:         uuid.New(),
+		StartTime:       start,
+		EndTime:         end,
+		CompactionLevel: level,
+	}}
+}
+
+func TestGroupWithinRange(t *testing.T) {
+	base := time.Now()
+
+	tests := []struct {
+		name      string
+		blocks    []common.BackendBlock
+		r         time.Duration
+		minBlocks int
+		wantLen   int
+	}{
+		{
+			name: "adjacent blocks within range are grouped",
+			blocks: []common.BackendBlock{
+				newFakeBlock(base, base.Add(time.Minute), 0),
+				newFakeBlock(base.Add(time.Minute), base.Add(2*time.Minute), 0),
+			},
+			r:         time.Hour,
+			minBlocks: 2,
+			wantLen:   2,
+		},
+		{
+			name: "blocks spanning more than the range are not grouped",
+			blocks: []common.BackendBlock{
+				newFakeBlock(base, base.Add(time.Minute), 0),
+				newFakeBlock(base.Add(2*time.Hour), base.Add(2*time.Hour+time.Minute), 0),
+			},
+			r:         time.Hour,
+			minBlocks: 2,
+			wantLen:   0,
+		},
+		{
+			name: "fewer than minBlocks is not a group",
+			blocks: []common.BackendBlock{
+				newFakeBlock(base, base.Add(time.Minute), 0),
+			},
+			r:         time.Hour,
+			minBlocks: 2,
+			wantLen:   0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			group := groupWithinRange(tc.blocks, tc.r, tc.minBlocks)
+			assert.Len(t, group, tc.wantLen)
+		})
+	}
+}
+
+// TestPlanCompactionExcludesBlocksNearingExpiry guards against the age
+// window being inverted: only blocks with plenty of time left before
+// CompleteBlockTimeout should be eligible, not the ones closest to it.
+func TestPlanCompactionExcludesBlocksNearingExpiry(t *testing.T) {
+	p := &Processor{
+		Cfg: Config{
+			CompleteBlockTimeout: time.Hour,
+			CompactionMinBlocks:  2,
+			CompactionRanges:     []time.Duration{time.Hour},
+		},
+		completeBlocks:   map[uuid.UUID]common.BackendBlock{},
+		compactingBlocks: map[uuid.UUID]struct{}{},
+	}
+
+	now := time.Now()
+
+	// Young blocks, well inside the safe half of CompleteBlockTimeout:
+	// these should be eligible for compaction.
+	young1 := newFakeBlock(now.Add(-time.Minute), now.Add(-30*time.Second), 0)
+	young2 := newFakeBlock(now.Add(-30*time.Second), now, 0)
+	p.completeBlocks[young1.BlockMeta().BlockID] = young1
+	p.completeBlocks[young2.BlockMeta().BlockID] = young2
+
+	// Old block, past the half-life of CompleteBlockTimeout and close to
+	// being removed by deleteOldBlocks: must never be selected.
+	old := newFakeBlock(now.Add(-59*time.Minute), now.Add(-58*time.Minute), 0)
+	p.completeBlocks[old.BlockMeta().BlockID] = old
+
+	group, level := p.planCompaction()
+	require.Len(t, group, 2)
+	assert.Equal(t, uint8(0), level)
+
+	for _, b := range group {
+		assert.NotEqual(t, old.BlockMeta().BlockID, b.BlockMeta().BlockID, "block nearing expiry must not be compacted")
+	}
+}
@@ -0,0 +1,79 @@
+package localblocks
+
+import (
+	"flag"
+	"time"
+
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding"
+	"github.com/grafana/tempo/tempodb/encoding/common"
+)
+
+// Config for the local blocks processor.
+type Config struct {
+	MaxLiveTraces        uint64              `yaml:"max_live_traces"`
+	MaxBlockDuration     time.Duration       `yaml:"max_block_duration"`
+	MaxBlockBytes        uint64              `yaml:"max_block_bytes"`
+	FlushCheckPeriod     time.Duration       `yaml:"flush_check_period"`
+	TraceIdlePeriod      time.Duration       `yaml:"trace_idle_period"`
+	CompleteBlockTimeout time.Duration       `yaml:"complete_block_timeout"`
+	Block                *common.BlockConfig `yaml:"block"`
+
+	// CheckpointInterval is how often liveTraces and block state are
+	// snapshotted to a checkpoint file, so a restart doesn't lose in-flight
+	// traces and doesn't need to re-fetch meta.json for already-complete
+	// blocks. It does not speed up the WAL rescan itself, which remains the
+	// dominant cost of a restart -- see reloadBlocks. Zero disables
+	// checkpointing.
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+	// CheckpointRetention is the number of checkpoint files to keep around.
+	CheckpointRetention int `yaml:"checkpoint_retention"`
+
+	// RemoteWrite configures uploading completed blocks to a remote backend.
+	RemoteWrite RemoteWriteConfig `yaml:"remote_write"`
+
+	// Filter controls which spans are retained by the processor.
+	Filter FilterConfig `yaml:"filter"`
+
+	// CompactionRanges are the tier boundaries complete blocks are grouped
+	// into for compaction, ascending. Adjacent blocks of the same compaction
+	// level form a group when the span from the first block's StartTime to
+	// the last block's EndTime fits within a range; ranges are tried in
+	// order. A block's compaction level does not limit which ranges it is
+	// grouped under.
+	CompactionRanges []time.Duration `yaml:"compaction_ranges"`
+	// CompactionMinBlocks is the minimum number of adjacent blocks in a tier
+	// required before they're compacted together.
+	CompactionMinBlocks int `yaml:"compaction_min_blocks"`
+	// CompactionConcurrency bounds how many compactions run at once.
+	CompactionConcurrency int `yaml:"compaction_concurrency"`
+}
+
+func (cfg *Config) RegisterFlagsAndApplyDefaults(prefix string, _ *flag.FlagSet) {
+	cfg.MaxLiveTraces = 10_000
+	cfg.MaxBlockDuration = 5 * time.Minute
+	cfg.MaxBlockBytes = 500 * 1024 * 1024
+	cfg.FlushCheckPeriod = 10 * time.Second
+	cfg.TraceIdlePeriod = 10 * time.Second
+	cfg.CompleteBlockTimeout = 15 * time.Minute
+	cfg.CheckpointInterval = 15 * time.Minute
+	cfg.CheckpointRetention = 2
+	cfg.Block = &common.BlockConfig{
+		BloomFP:              0.01,
+		BloomShardSizeBytes:  100 * 1024,
+		Version:              encoding.DefaultEncoding().Version(),
+		Encoding:             backend.EncZstd,
+		IndexDownsampleBytes: 1024 * 1024,
+		IndexPageSizeBytes:   250 * 1024,
+	}
+	cfg.RemoteWrite.RegisterFlagsAndApplyDefaults(prefix)
+	cfg.Filter.RegisterFlagsAndApplyDefaults(prefix)
+
+	cfg.CompactionRanges = []time.Duration{
+		cfg.MaxBlockDuration,
+		3 * cfg.MaxBlockDuration,
+		9 * cfg.MaxBlockDuration,
+	}
+	cfg.CompactionMinBlocks = 2
+	cfg.CompactionConcurrency = 1
+}
@@ -0,0 +1,337 @@
+package localblocks
+
+import (
+	"regexp"
+	"strconv"
+
+	v1 "github.com/grafana/tempo/pkg/tempopb/trace/v1"
+	"github.com/pkg/errors"
+)
+
+// FilterMatchType mirrors spanmetrics.FilterMatchType: either an exact match
+// on the attribute value, a regex match, or a numeric comparison.
+type FilterMatchType string
+
+const (
+	MatchTypeStrict  FilterMatchType = "strict"
+	MatchTypeRegex   FilterMatchType = "regex"
+	MatchTypeCompare FilterMatchType = "compare"
+)
+
+// compareRE parses a MatchTypeCompare value such as ">=500" or "<10.5" into
+// its operator and numeric threshold.
+var compareRE = regexp.MustCompile(`^(>=|<=|>|<|==|!=)\s*(-?\d+(?:\.\d+)?)$`)
+
+// MatchPolicyAttribute is a single key/value pair to match against a span's
+// resource or span-level attributes. A nil Value only checks for the
+// attribute's existence.
+type MatchPolicyAttribute struct {
+	Key   string      `yaml:"key"`
+	Value interface{} `yaml:"value"`
+}
+
+// PolicyMatch is a set of attribute matchers that must all match (logical
+// AND) for the policy to apply.
+type PolicyMatch struct {
+	MatchType  FilterMatchType        `yaml:"match_type"`
+	Attributes []MatchPolicyAttribute `yaml:"attributes"`
+}
+
+// FilterPolicy includes or excludes spans based on resource/span attribute
+// matches, analogous to spanmetrics.FilterPolicy.
+type FilterPolicy struct {
+	Include *PolicyMatch `yaml:"include"`
+	Exclude *PolicyMatch `yaml:"exclude"`
+}
+
+// FilterConfig controls which spans the local blocks processor retains.
+type FilterConfig struct {
+	// IncludeAllSpans disables span.kind filtering entirely; every span kind
+	// is eligible (still subject to FilterPolicies).
+	IncludeAllSpans bool `yaml:"include_all_spans"`
+	// SpanKinds is the set of span kinds retained when IncludeAllSpans is
+	// false. Defaults to SERVER for backwards compatibility.
+	SpanKinds []v1.Span_SpanKind `yaml:"span_kinds"`
+	// FilterPolicies, when non-empty, additionally restrict retained spans
+	// to those matching at least one policy's Include (and no policy's
+	// Exclude).
+	FilterPolicies []FilterPolicy `yaml:"filter_policies"`
+}
+
+func (cfg *FilterConfig) RegisterFlagsAndApplyDefaults(_ string) {
+	cfg.SpanKinds = []v1.Span_SpanKind{v1.Span_SPAN_KIND_SERVER}
+}
+
+// spanMatcher is a compiled FilterConfig. It's built once per config change
+// so PushSpans doesn't allocate or compile regexes on every batch.
+type spanMatcher struct {
+	includeAllSpans bool
+	kinds           map[v1.Span_SpanKind]struct{}
+	policies        []compiledPolicy
+}
+
+type compiledPolicy struct {
+	include *compiledPolicyMatch
+	exclude *compiledPolicyMatch
+}
+
+type compiledPolicyMatch struct {
+	strict  []MatchPolicyAttribute
+	regex   []compiledRegexAttribute
+	compare []compiledCompareAttribute
+	exists  []string
+}
+
+type compiledRegexAttribute struct {
+	key string
+	re  *regexp.Regexp
+}
+
+type compiledCompareAttribute struct {
+	key       string
+	op        string
+	threshold float64
+}
+
+func newSpanMatcher(cfg FilterConfig) (*spanMatcher, error) {
+	m := &spanMatcher{
+		includeAllSpans: cfg.IncludeAllSpans,
+		kinds:           map[v1.Span_SpanKind]struct{}{},
+	}
+
+	for _, k := range cfg.SpanKinds {
+		m.kinds[k] = struct{}{}
+	}
+
+	for _, p := range cfg.FilterPolicies {
+		cp := compiledPolicy{}
+
+		if p.Include != nil {
+			compiled, err := compilePolicyMatch(p.Include)
+			if err != nil {
+				return nil, errors.Wrap(err, "compiling include policy")
+			}
+			cp.include = compiled
+		}
+		if p.Exclude != nil {
+			compiled, err := compilePolicyMatch(p.Exclude)
+			if err != nil {
+				return nil, errors.Wrap(err, "compiling exclude policy")
+			}
+			cp.exclude = compiled
+		}
+
+		m.policies = append(m.policies, cp)
+	}
+
+	return m, nil
+}
+
+func compilePolicyMatch(p *PolicyMatch) (*compiledPolicyMatch, error) {
+	cpm := &compiledPolicyMatch{}
+
+	for _, attr := range p.Attributes {
+		if attr.Value == nil {
+			cpm.exists = append(cpm.exists, attr.Key)
+			continue
+		}
+
+		if p.MatchType == MatchTypeRegex {
+			s, ok := attr.Value.(string)
+			if !ok {
+				return nil, errors.Errorf("regex match for key %q requires a string value", attr.Key)
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "compiling regex for key %q", attr.Key)
+			}
+			cpm.regex = append(cpm.regex, compiledRegexAttribute{key: attr.Key, re: re})
+			continue
+		}
+
+		if p.MatchType == MatchTypeCompare {
+			s, ok := attr.Value.(string)
+			if !ok {
+				return nil, errors.Errorf("compare match for key %q requires a string value", attr.Key)
+			}
+			parts := compareRE.FindStringSubmatch(s)
+			if parts == nil {
+				return nil, errors.Errorf("compare match for key %q has invalid value %q, want e.g. \">=500\"", attr.Key, s)
+			}
+			threshold, err := strconv.ParseFloat(parts[2], 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing compare threshold for key %q", attr.Key)
+			}
+			cpm.compare = append(cpm.compare, compiledCompareAttribute{key: attr.Key, op: parts[1], threshold: threshold})
+			continue
+		}
+
+		cpm.strict = append(cpm.strict, attr)
+	}
+
+	return cpm, nil
+}
+
+// filterBatch returns a new ResourceSpans containing only the spans that
+// pass the matcher, or nil if none do. It does not modify the input.
+func (m *spanMatcher) filterBatch(batch *v1.ResourceSpans) *v1.ResourceSpans {
+	var keepSS []*v1.ScopeSpans
+
+	for _, ss := range batch.ScopeSpans {
+		var keepSpans []*v1.Span
+
+		for _, s := range ss.Spans {
+			if m.matches(batch, s) {
+				keepSpans = append(keepSpans, s)
+			}
+		}
+
+		if len(keepSpans) > 0 {
+			keepSS = append(keepSS, &v1.ScopeSpans{
+				Scope: ss.Scope,
+				Spans: keepSpans,
+			})
+		}
+	}
+
+	if len(keepSS) == 0 {
+		return nil
+	}
+
+	return &v1.ResourceSpans{
+		Resource:   batch.Resource,
+		ScopeSpans: keepSS,
+	}
+}
+
+func (m *spanMatcher) matches(batch *v1.ResourceSpans, s *v1.Span) bool {
+	if !m.includeAllSpans {
+		if _, ok := m.kinds[s.Kind]; !ok {
+			return false
+		}
+	}
+
+	if len(m.policies) == 0 {
+		return true
+	}
+
+	for _, p := range m.policies {
+		if p.exclude != nil && matchPolicy(p.exclude, batch, s) {
+			return false
+		}
+	}
+
+	for _, p := range m.policies {
+		if p.include == nil || matchPolicy(p.include, batch, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPolicy reports whether every attribute in pm matches, checking each
+// key against both resource and span attributes.
+func matchPolicy(pm *compiledPolicyMatch, batch *v1.ResourceSpans, s *v1.Span) bool {
+	for _, key := range pm.exists {
+		if !attributeExists(batch, s, key) {
+			return false
+		}
+	}
+
+	for _, attr := range pm.strict {
+		v, ok := attributeValue(batch, s, attr.Key)
+		if !ok || v != attr.Value {
+			return false
+		}
+	}
+
+	for _, attr := range pm.regex {
+		v, ok := attributeValue(batch, s, attr.key)
+		str, isStr := v.(string)
+		if !ok || !isStr || !attr.re.MatchString(str) {
+			return false
+		}
+	}
+
+	for _, attr := range pm.compare {
+		v, ok := attributeValue(batch, s, attr.key)
+		num, isNum := numericValue(v)
+		if !ok || !isNum || !compareNumeric(attr.op, num, attr.threshold) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// numericValue reports the float64 value of an int64 or float64 attribute,
+// the only two numeric AnyValue kinds anyValueToInterface produces.
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func compareNumeric(op string, v, threshold float64) bool {
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "==":
+		return v == threshold
+	case "!=":
+		return v != threshold
+	default:
+		return false
+	}
+}
+
+func attributeExists(batch *v1.ResourceSpans, s *v1.Span, key string) bool {
+	_, ok := attributeValue(batch, s, key)
+	return ok
+}
+
+func attributeValue(batch *v1.ResourceSpans, s *v1.Span, key string) (interface{}, bool) {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return anyValueToInterface(kv.Value), true
+		}
+	}
+	if batch.Resource != nil {
+		for _, kv := range batch.Resource.Attributes {
+			if kv.Key == key {
+				return anyValueToInterface(kv.Value), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func anyValueToInterface(v *v1.AnyValue) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch val := v.Value.(type) {
+	case *v1.AnyValue_StringValue:
+		return val.StringValue
+	case *v1.AnyValue_BoolValue:
+		return val.BoolValue
+	case *v1.AnyValue_IntValue:
+		return val.IntValue
+	case *v1.AnyValue_DoubleValue:
+		return val.DoubleValue
+	default:
+		return nil
+	}
+}
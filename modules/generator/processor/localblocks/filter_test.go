@@ -0,0 +1,253 @@
+package localblocks
+
+import (
+	"testing"
+
+	v1 "github.com/grafana/tempo/pkg/tempopb/trace/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strAttr(key, value string) *v1.KeyValue {
+	return &v1.KeyValue{Key: key, Value: &v1.AnyValue{Value: &v1.AnyValue_StringValue{StringValue: value}}}
+}
+
+func TestSpanMatcherKind(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		SpanKinds: []v1.Span_SpanKind{v1.Span_SPAN_KIND_SERVER},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{}
+
+	assert.True(t, m.matches(batch, &v1.Span{Kind: v1.Span_SPAN_KIND_SERVER}))
+	assert.False(t, m.matches(batch, &v1.Span{Kind: v1.Span_SPAN_KIND_CLIENT}))
+}
+
+func TestSpanMatcherIncludeAllSpans(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		IncludeAllSpans: true,
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{}
+
+	assert.True(t, m.matches(batch, &v1.Span{Kind: v1.Span_SPAN_KIND_CLIENT}))
+}
+
+func TestSpanMatcherStrictPolicy(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		IncludeAllSpans: true,
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					MatchType:  MatchTypeStrict,
+					Attributes: []MatchPolicyAttribute{{Key: "http.method", Value: "GET"}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{}
+
+	get := &v1.Span{Attributes: []*v1.KeyValue{strAttr("http.method", "GET")}}
+	post := &v1.Span{Attributes: []*v1.KeyValue{strAttr("http.method", "POST")}}
+	none := &v1.Span{}
+
+	assert.True(t, m.matches(batch, get))
+	assert.False(t, m.matches(batch, post))
+	assert.False(t, m.matches(batch, none))
+}
+
+func TestSpanMatcherStrictPolicyChecksResourceAttributes(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		IncludeAllSpans: true,
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					MatchType:  MatchTypeStrict,
+					Attributes: []MatchPolicyAttribute{{Key: "service.name", Value: "foo"}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{
+		Resource: &v1.Resource{Attributes: []*v1.KeyValue{strAttr("service.name", "foo")}},
+	}
+
+	assert.True(t, m.matches(batch, &v1.Span{}))
+}
+
+func TestSpanMatcherRegexPolicy(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		IncludeAllSpans: true,
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					MatchType:  MatchTypeRegex,
+					Attributes: []MatchPolicyAttribute{{Key: "http.route", Value: "^/api/.*"}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{}
+
+	assert.True(t, m.matches(batch, &v1.Span{Attributes: []*v1.KeyValue{strAttr("http.route", "/api/users")}}))
+	assert.False(t, m.matches(batch, &v1.Span{Attributes: []*v1.KeyValue{strAttr("http.route", "/static/app.js")}}))
+}
+
+func TestSpanMatcherExcludeTakesPrecedence(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		IncludeAllSpans: true,
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					MatchType:  MatchTypeStrict,
+					Attributes: []MatchPolicyAttribute{{Key: "http.method", Value: "GET"}},
+				},
+				Exclude: &PolicyMatch{
+					MatchType:  MatchTypeStrict,
+					Attributes: []MatchPolicyAttribute{{Key: "http.route", Value: "/healthz"}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{}
+
+	health := &v1.Span{Attributes: []*v1.KeyValue{
+		strAttr("http.method", "GET"),
+		strAttr("http.route", "/healthz"),
+	}}
+	other := &v1.Span{Attributes: []*v1.KeyValue{
+		strAttr("http.method", "GET"),
+		strAttr("http.route", "/users"),
+	}}
+
+	assert.False(t, m.matches(batch, health))
+	assert.True(t, m.matches(batch, other))
+}
+
+func TestSpanMatcherExistsPolicy(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		IncludeAllSpans: true,
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					Attributes: []MatchPolicyAttribute{{Key: "error", Value: nil}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{}
+
+	withError := &v1.Span{Attributes: []*v1.KeyValue{strAttr("error", "true")}}
+	withoutError := &v1.Span{}
+
+	assert.True(t, m.matches(batch, withError))
+	assert.False(t, m.matches(batch, withoutError))
+}
+
+func intAttr(key string, value int64) *v1.KeyValue {
+	return &v1.KeyValue{Key: key, Value: &v1.AnyValue{Value: &v1.AnyValue_IntValue{IntValue: value}}}
+}
+
+func TestSpanMatcherComparePolicy(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		IncludeAllSpans: true,
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					MatchType:  MatchTypeCompare,
+					Attributes: []MatchPolicyAttribute{{Key: "http.status_code", Value: ">=500"}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{}
+
+	serverError := &v1.Span{Attributes: []*v1.KeyValue{intAttr("http.status_code", 503)}}
+	ok := &v1.Span{Attributes: []*v1.KeyValue{intAttr("http.status_code", 200)}}
+	none := &v1.Span{}
+
+	assert.True(t, m.matches(batch, serverError))
+	assert.False(t, m.matches(batch, ok))
+	assert.False(t, m.matches(batch, none))
+}
+
+func TestNewSpanMatcherInvalidCompareValue(t *testing.T) {
+	_, err := newSpanMatcher(FilterConfig{
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					MatchType:  MatchTypeCompare,
+					Attributes: []MatchPolicyAttribute{{Key: "http.status_code", Value: "500"}},
+				},
+			},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestNewSpanMatcherInvalidRegex(t *testing.T) {
+	_, err := newSpanMatcher(FilterConfig{
+		FilterPolicies: []FilterPolicy{
+			{
+				Include: &PolicyMatch{
+					MatchType:  MatchTypeRegex,
+					Attributes: []MatchPolicyAttribute{{Key: "http.route", Value: "("}},
+				},
+			},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestFilterBatchDropsNonMatchingSpans(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		SpanKinds: []v1.Span_SpanKind{v1.Span_SPAN_KIND_SERVER},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{
+		ScopeSpans: []*v1.ScopeSpans{
+			{
+				Spans: []*v1.Span{
+					{Kind: v1.Span_SPAN_KIND_SERVER},
+					{Kind: v1.Span_SPAN_KIND_CLIENT},
+				},
+			},
+		},
+	}
+
+	filtered := m.filterBatch(batch)
+	require.NotNil(t, filtered)
+	require.Len(t, filtered.ScopeSpans, 1)
+	assert.Len(t, filtered.ScopeSpans[0].Spans, 1)
+	assert.Equal(t, v1.Span_SPAN_KIND_SERVER, filtered.ScopeSpans[0].Spans[0].Kind)
+}
+
+func TestFilterBatchReturnsNilWhenNothingMatches(t *testing.T) {
+	m, err := newSpanMatcher(FilterConfig{
+		SpanKinds: []v1.Span_SpanKind{v1.Span_SPAN_KIND_SERVER},
+	})
+	require.NoError(t, err)
+
+	batch := &v1.ResourceSpans{
+		ScopeSpans: []*v1.ScopeSpans{
+			{Spans: []*v1.Span{{Kind: v1.Span_SPAN_KIND_CLIENT}}},
+		},
+	}
+
+	assert.Nil(t, m.filterBatch(batch))
+}
@@ -0,0 +1,105 @@
+package localblocks
+
+import (
+	"encoding/binary"
+	"time"
+
+	v1 "github.com/grafana/tempo/pkg/tempopb/trace/v1"
+	"github.com/grafana/tempo/tempodb/encoding/common"
+	"github.com/pkg/errors"
+)
+
+var errMaxExceeded = errors.New("max live traces exceeded")
+
+// liveTrace accumulates the batches received for a single trace until it is
+// cut into a block.
+type liveTrace struct {
+	id        common.ID
+	Batches   []*v1.ResourceSpans
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// liveTraces holds the set of traces currently being appended to by
+// PushSpans, keyed by a fingerprint of the trace ID. Callers must hold
+// Processor.liveTracesMtx.
+type liveTraces struct {
+	traces map[uint64]*liveTrace
+}
+
+func newLiveTraces() *liveTraces {
+	return &liveTraces{
+		traces: map[uint64]*liveTrace{},
+	}
+}
+
+func (l *liveTraces) Len() int {
+	return len(l.traces)
+}
+
+// Push adds the given batch to the trace it belongs to, creating a new live
+// trace if this is the first batch seen for it. Returns errMaxExceeded if
+// adding a new trace would exceed max and the batch's trace isn't already
+// tracked.
+func (l *liveTraces) Push(batch *v1.ResourceSpans, max uint64) error {
+	id := traceIDFromBatch(batch)
+	if len(id) == 0 {
+		return nil
+	}
+
+	fp := fingerprint(id)
+
+	tr := l.traces[fp]
+	if tr == nil {
+		if max > 0 && uint64(len(l.traces)) >= max {
+			return errMaxExceeded
+		}
+
+		tr = &liveTrace{
+			id:        id,
+			createdAt: time.Now(),
+		}
+		l.traces[fp] = tr
+	}
+
+	tr.Batches = append(tr.Batches, batch)
+	tr.updatedAt = time.Now()
+
+	return nil
+}
+
+// CutIdle removes and returns all traces that haven't been updated since the
+// given time.
+func (l *liveTraces) CutIdle(since time.Time) []*liveTrace {
+	var cut []*liveTrace
+
+	for fp, tr := range l.traces {
+		if tr.updatedAt.Before(since) {
+			cut = append(cut, tr)
+			delete(l.traces, fp)
+		}
+	}
+
+	return cut
+}
+
+func traceIDFromBatch(batch *v1.ResourceSpans) common.ID {
+	for _, ss := range batch.ScopeSpans {
+		for _, s := range ss.Spans {
+			if len(s.TraceId) > 0 {
+				return common.ID(s.TraceId)
+			}
+		}
+	}
+	return nil
+}
+
+func fingerprint(id common.ID) uint64 {
+	if len(id) >= 8 {
+		return binary.LittleEndian.Uint64(id[:8])
+	}
+
+	var b [8]byte
+	copy(b[:], id)
+	return binary.LittleEndian.Uint64(b[:])
+}
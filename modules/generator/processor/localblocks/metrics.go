@@ -0,0 +1,96 @@
+package localblocks
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	reasonLiveTracesExceeded = "live_traces_exceeded"
+)
+
+var (
+	metricDroppedTraces = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "traces_dropped_total",
+		Help:      "The total number of traces dropped per tenant",
+	}, []string{"tenant", "reason"})
+
+	metricTotalTraces = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "traces_total",
+		Help:      "The total number of traces created per tenant",
+	}, []string{"tenant"})
+
+	metricLiveTraces = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "live_traces",
+		Help:      "The current number of live traces per tenant",
+	}, []string{"tenant"})
+
+	metricBlockSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "bytes",
+		Help:      "The current size of all blocks (head, wal, complete) in bytes per tenant",
+	}, []string{"tenant"})
+
+	metricRemoteWriteUploaded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "remote_write_blocks_uploaded_total",
+		Help:      "The total number of blocks successfully uploaded to the remote backend",
+	}, []string{"tenant"})
+
+	metricRemoteWriteFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "remote_write_blocks_failed_total",
+		Help:      "The total number of blocks that failed to upload to the remote backend, including blocks dropped because the upload queue was full",
+	}, []string{"tenant"})
+
+	metricRemoteWriteQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "remote_write_blocks_queued",
+		Help:      "The current number of blocks queued for upload to the remote backend",
+	}, []string{"tenant"})
+
+	metricRemoteWriteBacklogBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "remote_write_backlog_bytes",
+		Help:      "The current size in bytes of blocks queued for upload to the remote backend",
+	}, []string{"tenant"})
+
+	metricCompactionsAttempted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "compactions_attempted_total",
+		Help:      "The total number of compactions attempted",
+	}, []string{"tenant"})
+
+	metricCompactionsSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "compactions_succeeded_total",
+		Help:      "The total number of successful compactions",
+	}, []string{"tenant"})
+
+	metricCompactionsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "compactions_failed_total",
+		Help:      "The total number of failed compactions",
+	}, []string{"tenant"})
+
+	metricCompactionBytesReclaimed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tempo",
+		Subsystem: "metrics_generator_processor_local_blocks",
+		Name:      "compaction_bytes_reclaimed_total",
+		Help:      "The total number of bytes reclaimed by compacting smaller blocks into larger ones",
+	}, []string{"tenant"})
+)
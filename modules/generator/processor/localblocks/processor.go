@@ -13,7 +13,6 @@ import (
 	gen "github.com/grafana/tempo/modules/generator/processor"
 	"github.com/grafana/tempo/pkg/model"
 	"github.com/grafana/tempo/pkg/tempopb"
-	v1 "github.com/grafana/tempo/pkg/tempopb/trace/v1"
 	"github.com/grafana/tempo/pkg/util/log"
 	"github.com/grafana/tempo/tempodb/backend"
 	"github.com/grafana/tempo/tempodb/encoding"
@@ -29,14 +28,22 @@ type Processor struct {
 	closeCh chan struct{}
 	wg      sync.WaitGroup
 
-	blocksMtx      sync.Mutex
-	headBlock      common.WALBlock
-	walBlocks      map[uuid.UUID]common.WALBlock
-	completeBlocks map[uuid.UUID]common.BackendBlock
-	lastCutTime    time.Time
+	blocksMtx        sync.Mutex
+	headBlock        common.WALBlock
+	walBlocks        map[uuid.UUID]common.WALBlock
+	completeBlocks   map[uuid.UUID]common.BackendBlock
+	compactingBlocks map[uuid.UUID]struct{}
+	lastCutTime      time.Time
 
 	liveTracesMtx sync.Mutex
 	liveTraces    *liveTraces
+
+	checkpointSeqMtx sync.Mutex
+	checkpointSeq    int
+
+	sink *blockSink
+
+	filter *spanMatcher
 }
 
 var _ gen.Processor = (*Processor)(nil)
@@ -47,27 +54,43 @@ func New(cfg Config, tenant string, wal *wal.WAL) (*Processor, error) {
 		return nil, errors.New("local blocks processor requires traces wal")
 	}
 
-	p := &Processor{
-		Cfg:            cfg,
-		tenant:         tenant,
-		wal:            wal,
-		walBlocks:      map[uuid.UUID]common.WALBlock{},
-		completeBlocks: map[uuid.UUID]common.BackendBlock{},
-		liveTraces:     newLiveTraces(),
-		closeCh:        make(chan struct{}),
-		wg:             sync.WaitGroup{},
+	filter, err := newSpanMatcher(cfg.Filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "compiling filter config")
 	}
 
-	err := p.reloadBlocks()
+	p := &Processor{
+		filter:           filter,
+		Cfg:              cfg,
+		tenant:           tenant,
+		wal:              wal,
+		walBlocks:        map[uuid.UUID]common.WALBlock{},
+		completeBlocks:   map[uuid.UUID]common.BackendBlock{},
+		compactingBlocks: map[uuid.UUID]struct{}{},
+		liveTraces:       newLiveTraces(),
+		closeCh:          make(chan struct{}),
+		wg:               sync.WaitGroup{},
+	}
+
+	err = p.reloadBlocks()
 	if err != nil {
 		return nil, errors.Wrap(err, "replaying blocks")
 	}
 
-	p.wg.Add(4)
+	if cfg.RemoteWrite.Enabled {
+		p.sink, err = newBlockSink(cfg.RemoteWrite, tenant, wal.LocalBackend())
+		if err != nil {
+			return nil, errors.Wrap(err, "creating remote write sink")
+		}
+	}
+
+	p.wg.Add(6)
 	go p.flushLoop()
 	go p.deleteLoop()
 	go p.completeLoop()
 	go p.metricLoop()
+	go p.checkpointLoop()
+	go p.compactionLoop()
 
 	return p, nil
 }
@@ -84,7 +107,7 @@ func (p *Processor) PushSpans(ctx context.Context, req *tempopb.PushSpansRequest
 	before := p.liveTraces.Len()
 
 	for _, batch := range req.Batches {
-		if batch = filterBatch(batch); batch != nil {
+		if batch = p.filter.filterBatch(batch); batch != nil {
 			switch err := p.liveTraces.Push(batch, p.Cfg.MaxLiveTraces); err {
 			case errMaxExceeded:
 				metricDroppedTraces.WithLabelValues(p.tenant, reasonLiveTracesExceeded).Inc()
@@ -112,6 +135,10 @@ func (p *Processor) Shutdown(ctx context.Context) {
 	if err != nil {
 		level.Error(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to cut head block on shutdown", "err", err)
 	}
+
+	if p.sink != nil {
+		p.sink.Shutdown()
+	}
 }
 
 func (p *Processor) flushLoop() {
@@ -229,6 +256,10 @@ func (p *Processor) completeBlock() error {
 
 		p.completeBlocks[newMeta.BlockID] = newBlock
 
+		if p.sink != nil {
+			p.sink.Push(newMeta)
+		}
+
 		err = b.Clear()
 		if err != nil {
 			return err
@@ -384,6 +415,22 @@ func (p *Processor) cutBlocks(immediate bool) error {
 	return nil
 }
 
+// reloadBlocks rebuilds in-memory state from disk on startup. When a valid
+// checkpoint is present, it restores liveTraces and the head block directly
+// from it and skips re-fetching meta.json for blocks that were already
+// complete as of the checkpoint. On a missing or corrupt checkpoint it falls
+// back to deriving everything from disk.
+//
+// This does NOT make restart fast: wal.WAL doesn't expose a way to skip
+// rescanning WAL segments, or to truncate/resume a segment partway through,
+// so RescanBlocks still walks and replays every record of every segment on
+// disk regardless of the checkpoint -- which remains the dominant cost for a
+// generator with a large WAL. additionalStartSlack only tells RescanBlocks
+// how many of the head block's bytes were already known-good as of the
+// checkpoint; real segment-level truncation/skip would need a change to
+// wal.WAL itself, which is out of scope here. What this buys, concretely, is
+// avoiding redundant meta.json reads for already-complete blocks and
+// restoring liveTraces across a restart instead of losing in-flight traces.
 func (p *Processor) reloadBlocks() error {
 	var (
 		ctx = context.Background()
@@ -392,20 +439,47 @@ func (p *Processor) reloadBlocks() error {
 		r   = backend.NewReader(l)
 	)
 
+	ck, nextSeq, err := loadLatestCheckpoint(p.checkpointDir())
+	if err != nil {
+		level.Error(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to look up checkpoints, falling back to full scan", "err", err)
+	}
+	p.checkpointSeq = nextSeq
+
+	var additionalStartSlack uint32
+	if ck != nil {
+		additionalStartSlack = uint32(ck.HeadBlockLen)
+	}
+
 	// ------------------------------------
 	// wal blocks
 	// ------------------------------------
-	walBlocks, err := p.wal.RescanBlocks(0, log.Logger)
+	walBlocks, err := p.wal.RescanBlocks(additionalStartSlack, log.Logger)
 	if err != nil {
 		return err
 	}
+
+	rescanned := map[uuid.UUID]common.WALBlock{}
 	for _, blk := range walBlocks {
 		meta := blk.BlockMeta()
 		if meta.TenantID == p.tenant {
-			p.walBlocks[blk.BlockMeta().BlockID] = blk
+			rescanned[meta.BlockID] = blk
+		}
+	}
+
+	known := map[uuid.UUID]struct{}{}
+
+	if ck != nil {
+		known, err = p.restoreFromCheckpoint(ck, rescanned)
+		if err != nil {
+			level.Error(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to restore checkpoint, falling back to full scan", "err", err)
+			known = map[uuid.UUID]struct{}{}
 		}
 	}
 
+	for id, blk := range rescanned {
+		p.walBlocks[id] = blk
+	}
+
 	// ------------------------------------
 	// Complete blocks
 	// ------------------------------------
@@ -426,6 +500,18 @@ func (p *Processor) reloadBlocks() error {
 	}
 
 	for _, id := range ids {
+		if _, ok := known[id]; ok {
+			// Already recorded in the checkpoint, no need to fetch its
+			// meta.json again.
+			blk, err := encoding.OpenBlock(blockMetaFromCheckpoint(ck, id), r)
+			if err == nil {
+				p.completeBlocks[id] = blk
+				continue
+			}
+			// Fall through to a full reload if the cached meta didn't pan out.
+			level.Warn(log.WithUserID(p.tenant, log.Logger)).Log("msg", "local blocks processor failed to open block from checkpoint, falling back to full read", "block", id, "err", err)
+		}
+
 		meta, err := r.BlockMeta(ctx, id, t)
 
 		if err == backend.ErrDoesNotExist {
@@ -452,6 +538,15 @@ func (p *Processor) reloadBlocks() error {
 	return nil
 }
 
+func blockMetaFromCheckpoint(ck *checkpoint, id uuid.UUID) *backend.BlockMeta {
+	for _, meta := range ck.CompleteBlocks {
+		if meta.BlockID == id {
+			return meta
+		}
+	}
+	return nil
+}
+
 func (p *Processor) recordBlockBytes() {
 	p.blocksMtx.Lock()
 	defer p.blocksMtx.Unlock()
@@ -470,36 +565,3 @@ func (p *Processor) recordBlockBytes() {
 
 	metricBlockSize.WithLabelValues(p.tenant).Set(float64(sum))
 }
-
-// filterBatch to only spans with kind==server. Does not modify the input
-// but returns a new struct referencing the same input pointers. Returns nil
-// if there were no matching spans.
-func filterBatch(batch *v1.ResourceSpans) *v1.ResourceSpans {
-
-	var keepSS []*v1.ScopeSpans
-	for _, ss := range batch.ScopeSpans {
-
-		var keepSpans []*v1.Span
-		for _, s := range ss.Spans {
-			if s.Kind == v1.Span_SPAN_KIND_SERVER {
-				keepSpans = append(keepSpans, s)
-			}
-		}
-
-		if len(keepSpans) > 0 {
-			keepSS = append(keepSS, &v1.ScopeSpans{
-				Scope: ss.Scope,
-				Spans: keepSpans,
-			})
-		}
-	}
-
-	if len(keepSS) > 0 {
-		return &v1.ResourceSpans{
-			Resource:   batch.Resource,
-			ScopeSpans: keepSS,
-		}
-	}
-
-	return nil
-}
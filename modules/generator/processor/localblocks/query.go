@@ -0,0 +1,260 @@
+// Package-level note on scope: this file implements only the generator-side
+// half of "local TraceQL search" -- Search/SearchTags/FindTraceByID below,
+// and the HTTP handlers in ../../api.go that call them. It is intentionally
+// partial. The querier-side ring fan-out (querying generator replicas via
+// RingKey and merging with backend results) is not implemented: modules/
+// querier does not exist in this tree. Nor is there a Generator service/
+// instance manager here to register api.go's routes on a real router. Until
+// both of those land, this is a library of query logic with no caller --
+// track the ring fan-out and route wiring as their own follow-up work
+// rather than assuming they're covered by this change.
+package localblocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/tempo/pkg/tempopb"
+	v1 "github.com/grafana/tempo/pkg/tempopb/trace/v1"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/grafana/tempo/tempodb/encoding/common"
+)
+
+// QueryBudget bounds how much work a single generator-side query is allowed
+// to do, since it runs inline on the processor's own goroutines rather than
+// against a dedicated query path.
+type QueryBudget struct {
+	MaxBytes   uint64
+	MaxElapsed time.Duration
+}
+
+// DefaultQueryBudget is used when a caller doesn't specify one.
+var DefaultQueryBudget = QueryBudget{
+	MaxBytes:   20 * 1024 * 1024,
+	MaxElapsed: 5 * time.Second,
+}
+
+// Search looks for traces matching req across the live, WAL, and complete
+// blocks held by this processor, merging the results. When either bound is
+// set, blocks whose StartTime/EndTime range does not overlap
+// [req.Start, req.End] are skipped, and a live trace is only matched if the
+// span from its first to its last received batch overlaps that window.
+func (p *Processor) Search(ctx context.Context, req *tempopb.SearchRequest, budget QueryBudget) (*tempopb.SearchResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget.MaxElapsed)
+	defer cancel()
+
+	resp := &tempopb.SearchResponse{
+		Metrics: &tempopb.SearchMetrics{},
+	}
+
+	var bytesRead uint64
+
+	for _, b := range p.searchableBlocks() {
+		if exceedsWindow(b.BlockMeta().StartTime, b.BlockMeta().EndTime, req) {
+			continue
+		}
+
+		r, err := b.Search(ctx, req, common.DefaultSearchOptions())
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Traces = append(resp.Traces, r.Traces...)
+		if r.Metrics != nil {
+			resp.Metrics.InspectedBytes += r.Metrics.InspectedBytes
+			resp.Metrics.InspectedTraces += r.Metrics.InspectedTraces
+		}
+
+		bytesRead += r.Metrics.GetInspectedBytes()
+		if bytesRead >= budget.MaxBytes || uint32(len(resp.Traces)) >= req.Limit && req.Limit > 0 {
+			break
+		}
+	}
+
+	p.liveTracesMtx.Lock()
+	for _, t := range p.liveTraces.traces {
+		if req.Limit > 0 && uint32(len(resp.Traces)) >= req.Limit {
+			break
+		}
+		if md := matchLiveTrace(t, req); md != nil {
+			resp.Traces = append(resp.Traces, md)
+		}
+	}
+	p.liveTracesMtx.Unlock()
+
+	return resp, nil
+}
+
+// SearchTags returns the set of distinct tag keys seen across live, WAL, and
+// complete blocks for the given scope ("resource", "span", or "" for both).
+func (p *Processor) SearchTags(ctx context.Context, scope string, budget QueryBudget) (*tempopb.SearchTagsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget.MaxElapsed)
+	defer cancel()
+
+	seen := map[string]struct{}{}
+	cb := func(tag string) {
+		seen[tag] = struct{}{}
+	}
+
+	for _, b := range p.searchableBlocks() {
+		if err := b.SearchTags(ctx, scope, cb, common.DefaultSearchOptions()); err != nil {
+			return nil, err
+		}
+	}
+
+	p.liveTracesMtx.Lock()
+	for _, t := range p.liveTraces.traces {
+		for _, batch := range t.Batches {
+			collectLiveTags(batch, scope, cb)
+		}
+	}
+	p.liveTracesMtx.Unlock()
+
+	resp := &tempopb.SearchTagsResponse{}
+	for tag := range seen {
+		resp.TagNames = append(resp.TagNames, tag)
+	}
+
+	return resp, nil
+}
+
+// FindTraceByID looks up a single trace by ID across live, WAL, and complete
+// blocks, merging any fragments found in each.
+func (p *Processor) FindTraceByID(ctx context.Context, id common.ID, budget QueryBudget) (*tempopb.Trace, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget.MaxElapsed)
+	defer cancel()
+
+	trace := &tempopb.Trace{}
+
+	for _, b := range p.searchableBlocks() {
+		t, err := b.FindTraceByID(ctx, id, common.DefaultSearchOptions())
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			trace.Batches = append(trace.Batches, t.Batches...)
+		}
+	}
+
+	p.liveTracesMtx.Lock()
+	for _, t := range p.liveTraces.traces {
+		if t.id.String() == id.String() {
+			trace.Batches = append(trace.Batches, t.Batches...)
+		}
+	}
+	p.liveTracesMtx.Unlock()
+
+	if len(trace.Batches) == 0 {
+		return nil, nil
+	}
+
+	return trace, nil
+}
+
+// searchableBlock is the subset of common.WALBlock/common.BackendBlock this
+// package needs for unindexed, full-scan search.
+type searchableBlock interface {
+	BlockMeta() *backend.BlockMeta
+	Search(ctx context.Context, req *tempopb.SearchRequest, opts common.SearchOptions) (*tempopb.SearchResponse, error)
+	SearchTags(ctx context.Context, scope string, cb func(string), opts common.SearchOptions) error
+	FindTraceByID(ctx context.Context, id common.ID, opts common.SearchOptions) (*tempopb.Trace, error)
+}
+
+// searchableBlocks snapshots the current head, WAL, and complete blocks.
+// Callers must not hold blocksMtx.
+func (p *Processor) searchableBlocks() []searchableBlock {
+	p.blocksMtx.Lock()
+	defer p.blocksMtx.Unlock()
+
+	blocks := make([]searchableBlock, 0, len(p.walBlocks)+len(p.completeBlocks)+1)
+
+	if p.headBlock != nil {
+		blocks = append(blocks, p.headBlock)
+	}
+	for _, b := range p.walBlocks {
+		blocks = append(blocks, b)
+	}
+	for _, b := range p.completeBlocks {
+		blocks = append(blocks, b)
+	}
+
+	return blocks
+}
+
+func exceedsWindow(start, end time.Time, req *tempopb.SearchRequest) bool {
+	if req.Start > 0 && end.Before(time.Unix(int64(req.Start), 0)) {
+		return true
+	}
+	if req.End > 0 && start.After(time.Unix(int64(req.End), 0)) {
+		return true
+	}
+	return false
+}
+
+func matchLiveTrace(t *liveTrace, req *tempopb.SearchRequest) *tempopb.TraceSearchMetadata {
+	if req.Start > 0 && t.updatedAt.Before(time.Unix(int64(req.Start), 0)) {
+		return nil
+	}
+	if req.End > 0 && t.createdAt.After(time.Unix(int64(req.End), 0)) {
+		return nil
+	}
+
+	for k, v := range req.Tags {
+		if !liveTraceHasTag(t, k, v) {
+			return nil
+		}
+	}
+
+	return &tempopb.TraceSearchMetadata{
+		TraceID:           t.id.String(),
+		StartTimeUnixNano: uint64(t.createdAt.UnixNano()),
+	}
+}
+
+func liveTraceHasTag(t *liveTrace, key, value string) bool {
+	for _, batch := range t.Batches {
+		if attrMatches(batch.Resource.GetAttributes(), key, value) {
+			return true
+		}
+		for _, ss := range batch.ScopeSpans {
+			for _, s := range ss.Spans {
+				if attrMatches(s.Attributes, key, value) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func attrMatches(attrs []*v1.KeyValue, key, value string) bool {
+	for _, kv := range attrs {
+		if kv.Key != key {
+			continue
+		}
+		if value == "" {
+			return true
+		}
+		if s, ok := anyValueToInterface(kv.Value).(string); ok && s == value {
+			return true
+		}
+	}
+	return false
+}
+
+func collectLiveTags(batch *v1.ResourceSpans, scope string, cb func(string)) {
+	if scope == "" || scope == "resource" {
+		for _, kv := range batch.Resource.GetAttributes() {
+			cb(kv.Key)
+		}
+	}
+	if scope == "" || scope == "span" {
+		for _, ss := range batch.ScopeSpans {
+			for _, s := range ss.Spans {
+				for _, kv := range s.Attributes {
+					cb(kv.Key)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package localblocks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/tempo/pkg/util/log"
+	"github.com/grafana/tempo/tempodb/backend"
+	"github.com/pkg/errors"
+)
+
+// RemoteWriteConfig configures asynchronous upload of completed local blocks
+// to a remote tempodb backend, so the generator's recent data survives pod
+// loss and is queryable by the rest of the read path without waiting for
+// ingester flush.
+type RemoteWriteConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Backend is the tempodb backend to upload to (s3, gcs, azure).
+	Backend backend.Config `yaml:"backend"`
+	// Prefix blocks are uploaded under, to separate them from ingester blocks
+	// in the same bucket.
+	Prefix string `yaml:"prefix"`
+	// Concurrency is the number of blocks uploaded in parallel.
+	Concurrency int `yaml:"concurrency"`
+	// QueueSize bounds how many completed blocks can be queued for upload
+	// before Push starts dropping them.
+	QueueSize int `yaml:"queue_size"`
+	// MinBackoff/MaxBackoff/MaxRetries control the retry policy for a
+	// failed block upload.
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	MaxRetries int           `yaml:"max_retries"`
+	// ShutdownFlushDeadline bounds how long Shutdown waits for the upload
+	// queue to drain.
+	ShutdownFlushDeadline time.Duration `yaml:"shutdown_flush_deadline"`
+}
+
+func (cfg *RemoteWriteConfig) RegisterFlagsAndApplyDefaults(_ string) {
+	cfg.Prefix = "generator"
+	cfg.Concurrency = 2
+	cfg.QueueSize = 100
+	cfg.MinBackoff = time.Second
+	cfg.MaxBackoff = 30 * time.Second
+	cfg.MaxRetries = 5
+	cfg.ShutdownFlushDeadline = 30 * time.Second
+}
+
+// blockSink asynchronously copies completed blocks to a remote tempodb
+// backend.
+type blockSink struct {
+	tenant string
+	cfg    RemoteWriteConfig
+
+	// local/remote are the raw backends backing the copy, addressed object
+	// by object so the source (local, original tenant) and destination
+	// (remote, prefixed tenant) can use different tenant IDs -- something
+	// backend.CopyBlock, which addresses both sides from a single meta,
+	// can't do.
+	local  backend.RawReader
+	remote backend.RawWriter
+
+	queue   chan *backend.BlockMeta
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+func newBlockSink(cfg RemoteWriteConfig, tenant string, local backend.RawReader) (*blockSink, error) {
+	_, ww, _, err := backend.New(&cfg.Backend)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating remote write backend")
+	}
+
+	s := &blockSink{
+		tenant:  tenant,
+		cfg:     cfg,
+		local:   local,
+		remote:  ww,
+		queue:   make(chan *backend.BlockMeta, cfg.QueueSize),
+		closeCh: make(chan struct{}),
+	}
+
+	for i := 0; i < cfg.Concurrency; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+
+	return s, nil
+}
+
+// Push enqueues a completed block for upload. It does not block; if the
+// queue is full the block is dropped and counted so it doesn't hold up the
+// completeLoop.
+func (s *blockSink) Push(meta *backend.BlockMeta) {
+	select {
+	case s.queue <- meta:
+		metricRemoteWriteQueued.WithLabelValues(s.tenant).Inc()
+		metricRemoteWriteBacklogBytes.WithLabelValues(s.tenant).Add(float64(meta.Size))
+	default:
+		metricRemoteWriteFailed.WithLabelValues(s.tenant).Inc()
+		level.Error(log.WithUserID(s.tenant, log.Logger)).Log("msg", "local blocks remote write queue full, dropping block", "block", meta.BlockID)
+	}
+}
+
+func (s *blockSink) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case meta, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			metricRemoteWriteQueued.WithLabelValues(s.tenant).Dec()
+			s.upload(meta)
+
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+func (s *blockSink) upload(meta *backend.BlockMeta) {
+	// Cancel an in-progress copy once Shutdown's deadline closes closeCh.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closeCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Upload under a dedicated prefix so generator blocks don't collide
+	// with ingester blocks for the same tenant in the destination bucket.
+	// The block only exists locally under its own, unprefixed tenant, so
+	// the source side of the copy must keep using meta as-is; only the
+	// destination addressing gets the prefix.
+	remoteMeta := *meta
+	remoteMeta.TenantID = s.cfg.Prefix + "/" + meta.TenantID
+
+	backoff := s.cfg.MinBackoff
+	var err error
+
+	for attempt := 0; attempt <= s.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-s.closeCh:
+				return
+			}
+			if backoff *= 2; backoff > s.cfg.MaxBackoff {
+				backoff = s.cfg.MaxBackoff
+			}
+		}
+
+		err = s.copyBlock(ctx, meta, &remoteMeta)
+		if err == nil {
+			metricRemoteWriteUploaded.WithLabelValues(s.tenant).Inc()
+			metricRemoteWriteBacklogBytes.WithLabelValues(s.tenant).Sub(float64(meta.Size))
+			return
+		}
+
+		level.Warn(log.WithUserID(s.tenant, log.Logger)).Log("msg", "local blocks processor failed to upload block to remote backend, will retry", "block", meta.BlockID, "attempt", attempt, "err", err)
+	}
+
+	metricRemoteWriteFailed.WithLabelValues(s.tenant).Inc()
+	metricRemoteWriteBacklogBytes.WithLabelValues(s.tenant).Sub(float64(meta.Size))
+	level.Error(log.WithUserID(s.tenant, log.Logger)).Log("msg", "local blocks processor gave up uploading block to remote backend", "block", meta.BlockID, "err", err)
+}
+
+// copyBlock copies every backend object belonging to srcMeta's block from
+// the local backend to the remote one, reading under srcMeta's tenant and
+// writing under dstMeta's. backend.CopyBlock can't do this because it
+// addresses both the read and the write from a single shared meta.
+//
+// meta.json is written last, from dstMeta rather than copied verbatim from
+// the source, so the destination object always reflects dstMeta's tenant.
+func (s *blockSink) copyBlock(ctx context.Context, srcMeta, dstMeta *backend.BlockMeta) error {
+	srcPath := backend.KeyPathForBlock(srcMeta.BlockID, srcMeta.TenantID)
+	dstPath := backend.KeyPathForBlock(dstMeta.BlockID, dstMeta.TenantID)
+
+	names, err := s.local.List(ctx, srcPath)
+	if err != nil {
+		return errors.Wrap(err, "listing local block objects")
+	}
+
+	for _, name := range names {
+		if name == backend.MetaName {
+			continue
+		}
+
+		body, size, err := s.local.Read(ctx, name, srcPath, false)
+		if err != nil {
+			return errors.Wrapf(err, "reading local block object %q", name)
+		}
+
+		err = s.remote.Write(ctx, name, dstPath, body, size, false)
+		body.Close()
+		if err != nil {
+			return errors.Wrapf(err, "writing remote block object %q", name)
+		}
+	}
+
+	metaJSON, err := json.Marshal(dstMeta)
+	if err != nil {
+		return errors.Wrap(err, "marshaling block meta")
+	}
+
+	if err := s.remote.Write(ctx, backend.MetaName, dstPath, bytes.NewReader(metaJSON), int64(len(metaJSON)), false); err != nil {
+		return errors.Wrap(err, "writing remote block meta")
+	}
+
+	return nil
+}
+
+// Shutdown stops accepting new uploads and waits up to
+// cfg.ShutdownFlushDeadline for the queue to drain.
+func (s *blockSink) Shutdown() {
+	close(s.queue)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(s.cfg.ShutdownFlushDeadline):
+		close(s.closeCh)
+		<-done
+	}
+}